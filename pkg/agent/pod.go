@@ -0,0 +1,128 @@
+// Package agent assembles the per-IPPool DHCP agent pod spec.
+package agent
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	networkv1 "github.com/harvester/vm-dhcp-controller/pkg/apis/network.harvesterhci.io/v1alpha1"
+	"github.com/harvester/vm-dhcp-controller/pkg/util"
+)
+
+const dhcpContainerName = "dhcp"
+
+// PrepareAgentPod renders the IPPool's validated macFilter/dhcpOptions (and,
+// for dual-stack pools, the IPv6 pool range) into the dhcp container's args,
+// so operators can drive MAC allow/deny-listing, PXE/option delivery, and
+// DHCPv6/RA entirely through the CRD. Callers (the controller that builds
+// the agent pod spec for an IPPool) should call this last, after the pod's
+// "dhcp" container is in place and before the pod is submitted. pi is
+// assumed to already be validated (see pkg/webhook/ippool).
+func PrepareAgentPod(pod *corev1.Pod, ipPool *networkv1.IPPool, pi util.PoolInfo) error {
+	idx := -1
+	for i, c := range pod.Spec.Containers {
+		if c.Name == dhcpContainerName {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("agent pod for ippool %s/%s has no %q container", ipPool.Namespace, ipPool.Name, dhcpContainerName)
+	}
+
+	pod.Spec.Containers[idx].Args = append(pod.Spec.Containers[idx].Args, dhcpServerArgs(pi)...)
+
+	return nil
+}
+
+func dhcpServerArgs(pi util.PoolInfo) []string {
+	var args []string
+
+	if pi.IPv6IPNet != nil {
+		args = append(args, dhcpv6ServerArgs(pi)...)
+	}
+
+	if mf := pi.MACFilter; mf != nil {
+		for _, pattern := range mf.Patterns {
+			switch mf.Mode {
+			case networkv1.MACFilterModeAllow:
+				args = append(args, "--mac-allow="+pattern)
+			case networkv1.MACFilterModeDeny:
+				args = append(args, "--mac-deny="+pattern)
+			}
+		}
+	}
+
+	if opts := pi.DHCPOptions; opts != nil {
+		if len(opts.DNSServers) > 0 {
+			args = append(args, "--dns-server="+joinAddrs(opts.DNSServers))
+		}
+
+		if len(opts.NTPServers) > 0 {
+			args = append(args, "--ntp-server="+joinAddrs(opts.NTPServers))
+		}
+
+		if opts.DomainName != "" {
+			args = append(args, "--domain-name="+opts.DomainName)
+		}
+
+		if len(opts.DomainSearch) > 0 {
+			args = append(args, "--domain-search="+strings.Join(opts.DomainSearch, ","))
+		}
+
+		if opts.MTU != nil {
+			args = append(args, "--mtu="+strconv.Itoa(int(*opts.MTU)))
+		}
+
+		if opts.NextServer.IsValid() {
+			args = append(args, "--next-server="+opts.NextServer.String())
+		}
+
+		if opts.BootFileName != "" {
+			args = append(args, "--bootfile-name="+opts.BootFileName)
+		}
+
+		for _, code := range sortedOptionCodes(opts.Extra) {
+			args = append(args, fmt.Sprintf("--dhcp-option=%d,%s", code, opts.Extra[code]))
+		}
+	}
+
+	return args
+}
+
+// dhcpv6ServerArgs renders the pool's IPv6 pool range into the dnsmasq flags
+// that hand out DHCPv6 leases and advertise the prefix via router
+// advertisements. The IPv6 exclude ranges and reservations are not rendered.
+func dhcpv6ServerArgs(pi util.PoolInfo) []string {
+	var args []string
+
+	if pi.IPv6StartIPAddr.IsValid() && pi.IPv6EndIPAddr.IsValid() {
+		args = append(args, fmt.Sprintf("--dhcp-range=%s,%s,%d", pi.IPv6StartIPAddr, pi.IPv6EndIPAddr, pi.IPv6Prefix.Bits()))
+	}
+
+	args = append(args, "--enable-ra")
+
+	return args
+}
+
+func joinAddrs(addrs []netip.Addr) string {
+	parts := make([]string, len(addrs))
+	for i, a := range addrs {
+		parts[i] = a.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func sortedOptionCodes(extra map[int]string) []int {
+	codes := make([]int, 0, len(extra))
+	for code := range extra {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	return codes
+}
@@ -0,0 +1,84 @@
+// Package allocator picks IP addresses for an IPPool. It is the runtime
+// counterpart of the ippool webhook validator: the validator rejects pools
+// whose excludeRanges/reservations are malformed, this package is what
+// actually honors them when handing an address to a VM.
+package allocator
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/harvester/vm-dhcp-controller/pkg/util"
+)
+
+// ErrNoAvailableIP is returned when the pool range has no address left to hand out.
+var ErrNoAvailableIP = fmt.Errorf("no available ip in pool")
+
+// Allocate returns the IP address that should be handed to the given MAC
+// address for pi, honoring reservations (sticky, checked first) and
+// excludeRanges (never handed out dynamically). allocated maps each IP
+// already in use to the MAC it was handed to.
+func Allocate(pi util.PoolInfo, allocated map[netip.Addr]net.HardwareAddr, mac net.HardwareAddr) (netip.Addr, error) {
+	if reserved, ok := reservationFor(pi, mac); ok {
+		if owner, inUse := allocated[reserved]; inUse && owner.String() != mac.String() {
+			return netip.Addr{}, fmt.Errorf("reserved ip %s for %s is already allocated to %s", reserved, mac, owner)
+		}
+		return reserved, nil
+	}
+
+	for addr := pi.StartIPAddr; addr.IsValid() && !pi.EndIPAddr.Less(addr); addr = addr.Next() {
+		if isReservedForOther(pi, addr, mac) {
+			continue
+		}
+
+		if isExcluded(pi, addr) {
+			continue
+		}
+
+		if pi.ServerIPAddr.IsValid() && addr == pi.ServerIPAddr {
+			continue
+		}
+
+		if pi.RouterIPAddr.IsValid() && addr == pi.RouterIPAddr {
+			continue
+		}
+
+		if _, inUse := allocated[addr]; inUse {
+			continue
+		}
+
+		return addr, nil
+	}
+
+	return netip.Addr{}, ErrNoAvailableIP
+}
+
+func reservationFor(pi util.PoolInfo, mac net.HardwareAddr) (netip.Addr, bool) {
+	for _, r := range pi.Reservations {
+		if r.MACAddress.String() == mac.String() {
+			return r.IPAddr, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// isReservedForOther reports whether addr is reserved for a MAC address
+// other than mac, i.e. it is off-limits to dynamic allocation for mac.
+func isReservedForOther(pi util.PoolInfo, addr netip.Addr, mac net.HardwareAddr) bool {
+	for _, r := range pi.Reservations {
+		if r.IPAddr == addr {
+			return r.MACAddress.String() != mac.String()
+		}
+	}
+	return false
+}
+
+func isExcluded(pi util.PoolInfo, addr netip.Addr) bool {
+	for _, er := range pi.ExcludeRanges {
+		if er.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
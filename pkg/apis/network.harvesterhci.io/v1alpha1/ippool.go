@@ -0,0 +1,134 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// SchemeGroupVersion is the group/version used for all objects in this package.
+var SchemeGroupVersion = schema.GroupVersion{Group: "network.harvesterhci.io", Version: "v1alpha1"}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type IPPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IPPoolSpec   `json:"spec,omitempty"`
+	Status IPPoolStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type IPPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []IPPool `json:"items"`
+}
+
+type IPPoolSpec struct {
+	// NetworkName is the namespace/name of the NetworkAttachmentDefinition this pool serves.
+	NetworkName string `json:"networkName"`
+
+	IPv4Config IPv4Config `json:"ipv4Config"`
+
+	// IPv6Config runs the pool dual-stack alongside IPv4Config. Leave it nil
+	// to keep the pool IPv4-only.
+	IPv6Config *IPv6Config `json:"ipv6Config,omitempty"`
+
+	Paused *bool `json:"paused,omitempty"`
+}
+
+type IPv4Config struct {
+	ServerIP string `json:"serverIP,omitempty"`
+	CIDR     string `json:"cidr"`
+	Pool     Pool   `json:"pool,omitempty"`
+	Router   string `json:"router,omitempty"`
+
+	// ExcludeRanges carves addresses out of Pool that the allocator must never hand out.
+	ExcludeRanges []IPRange `json:"excludeRanges,omitempty"`
+
+	// Reservations are sticky IP/MAC bindings honored ahead of dynamic allocation.
+	Reservations []Reservation `json:"reservations,omitempty"`
+
+	MACFilter *MACFilter `json:"macFilter,omitempty"`
+
+	DHCPOptions *DHCPOptions `json:"dhcpOptions,omitempty"`
+}
+
+// IPv6Config is IPv4Config's IPv6 counterpart. MACFilter and DHCPOptions
+// aren't repeated here: they apply to the pool as a whole, not per-stack, and
+// DHCPOptions' address-typed fields (DNSServers, NTPServers, NextServer)
+// already accept IPv6 addresses.
+type IPv6Config struct {
+	ServerIP string `json:"serverIP,omitempty"`
+	CIDR     string `json:"cidr"`
+	Pool     Pool   `json:"pool,omitempty"`
+	Router   string `json:"router,omitempty"`
+
+	ExcludeRanges []IPRange     `json:"excludeRanges,omitempty"`
+	Reservations  []Reservation `json:"reservations,omitempty"`
+}
+
+const (
+	MACFilterModeAllow = "allow"
+	MACFilterModeDeny  = "deny"
+)
+
+// MACFilter restricts which clients the DHCP server will answer, by MAC
+// address or OUI prefix (e.g. "52:54:00").
+type MACFilter struct {
+	Mode     string   `json:"mode"`
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// DHCPOptions carries the operator-supplied DHCP options the agent renders
+// into the DHCP server's config: typed fields for the common ones (DNS, NTP,
+// domain search, MTU, PXE next-server/bootfile), plus Extra for anything else
+// the agent knows how to pass through by raw option code.
+type DHCPOptions struct {
+	DNSServers   []string `json:"dnsServers,omitempty"`
+	NTPServers   []string `json:"ntpServers,omitempty"`
+	DomainName   string   `json:"domainName,omitempty"`
+	DomainSearch []string `json:"domainSearch,omitempty"`
+	MTU          *uint16  `json:"mtu,omitempty"`
+
+	NextServer   string `json:"nextServer,omitempty"`
+	BootFileName string `json:"bootFileName,omitempty"`
+
+	// Extra maps a raw DHCP option code to its value, for options with no
+	// dedicated field above.
+	Extra map[int]string `json:"extra,omitempty"`
+}
+
+type Pool struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type IPRange struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type Reservation struct {
+	IP         string `json:"ip"`
+	MACAddress string `json:"macAddress"`
+	Hostname   string `json:"hostname,omitempty"`
+}
+
+type IPPoolStatus struct {
+	IPv4 *IPv4Status `json:"ipv4,omitempty"`
+	IPv6 *IPv6Status `json:"ipv6,omitempty"`
+}
+
+type IPv4Status struct {
+	// Allocated maps an allocated IP to the MAC address it was handed to.
+	Allocated map[string]string `json:"allocated,omitempty"`
+}
+
+type IPv6Status struct {
+	// Allocated maps an allocated IP to the MAC address it was handed to.
+	Allocated map[string]string `json:"allocated,omitempty"`
+}
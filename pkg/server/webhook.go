@@ -0,0 +1,16 @@
+package server
+
+import (
+	"github.com/harvester/webhook/pkg/server/admission"
+
+	ctlcniv1 "github.com/harvester/vm-dhcp-controller/pkg/generated/controllers/k8s.cni.cncf.io/v1"
+	ctlnetworkv1 "github.com/harvester/vm-dhcp-controller/pkg/generated/controllers/network.harvesterhci.io/v1alpha1"
+	"github.com/harvester/vm-dhcp-controller/pkg/webhook/ippool"
+)
+
+// Validators wires up every admission.Validator the webhook server serves.
+func Validators(nadCache ctlcniv1.NetworkAttachmentDefinitionCache, vmnetcfgCache ctlnetworkv1.VirtualMachineNetworkConfigCache, ippoolClient ctlnetworkv1.IPPoolClient) []admission.Validator {
+	return []admission.Validator{
+		ippool.NewValidator(nadCache, vmnetcfgCache, ippoolClient),
+	}
+}
@@ -0,0 +1,312 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	networkv1 "github.com/harvester/vm-dhcp-controller/pkg/apis/network.harvesterhci.io/v1alpha1"
+)
+
+// PoolInfo is the parsed, netip-based view of an IPPool's IPv4Config (and,
+// for dual-stack pools, IPv6Config) used by the validator and the allocator.
+// LoadPool is the single place raw spec strings are turned into
+// netip.Addr/net.IPNet so the rest of the code never has to re-parse or
+// special-case malformed input.
+type PoolInfo struct {
+	IPNet  *net.IPNet
+	Prefix netip.Prefix
+
+	NetworkIPAddr   netip.Addr
+	BroadcastIPAddr netip.Addr
+
+	StartIPAddr netip.Addr
+	EndIPAddr   netip.Addr
+
+	ServerIPAddr netip.Addr
+	RouterIPAddr netip.Addr
+
+	ExcludeRanges []ExcludeRange
+	Reservations  []Reservation
+
+	// IPv6IPNet is non-nil when the pool is dual-stack (Spec.IPv6Config set).
+	// There's no BroadcastIPAddr counterpart: IPv6 has no broadcast concept.
+	IPv6IPNet  *net.IPNet
+	IPv6Prefix netip.Prefix
+
+	IPv6NetworkIPAddr netip.Addr
+
+	IPv6StartIPAddr netip.Addr
+	IPv6EndIPAddr   netip.Addr
+
+	IPv6ServerIPAddr netip.Addr
+	IPv6RouterIPAddr netip.Addr
+
+	IPv6ExcludeRanges []ExcludeRange
+	IPv6Reservations  []Reservation
+
+	MACFilter   *MACFilter
+	DHCPOptions *DHCPOptions
+}
+
+type MACFilter struct {
+	Mode     string
+	Patterns []string
+}
+
+type DHCPOptions struct {
+	DNSServers   []netip.Addr
+	NTPServers   []netip.Addr
+	DomainName   string
+	DomainSearch []string
+	MTU          *uint16
+
+	NextServer   netip.Addr
+	BootFileName string
+
+	Extra map[int]string
+}
+
+type ExcludeRange struct {
+	StartIPAddr netip.Addr
+	EndIPAddr   netip.Addr
+}
+
+// Contains reports whether addr falls within the (inclusive) exclude range.
+func (er ExcludeRange) Contains(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	return !addr.Less(er.StartIPAddr) && !er.EndIPAddr.Less(addr)
+}
+
+type Reservation struct {
+	IPAddr     netip.Addr
+	MACAddress net.HardwareAddr
+	Hostname   string
+}
+
+// familyResult is the per-address-family slice of PoolInfo that LoadPool
+// fills in twice: once for the required IPv4Config, once more for the
+// optional IPv6Config.
+type familyResult struct {
+	IPNet  *net.IPNet
+	Prefix netip.Prefix
+
+	NetworkIPAddr netip.Addr
+
+	StartIPAddr netip.Addr
+	EndIPAddr   netip.Addr
+
+	ServerIPAddr netip.Addr
+	RouterIPAddr netip.Addr
+
+	ExcludeRanges []ExcludeRange
+	Reservations  []Reservation
+}
+
+// loadFamily parses one stack's worth of pool config (either IPv4Config or
+// IPv6Config - they share the same field shapes) into a familyResult.
+func loadFamily(cidr, start, end, serverIP, router string, excludeRanges []networkv1.IPRange, reservations []networkv1.Reservation) (familyResult, error) {
+	var fr familyResult
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fr, fmt.Errorf("invalid cidr %q: %w", cidr, err)
+	}
+	fr.IPNet = ipNet
+
+	prefix, err := netip.ParsePrefix(ipNet.String())
+	if err != nil {
+		return fr, fmt.Errorf("invalid cidr %q: %w", cidr, err)
+	}
+	fr.Prefix = prefix
+	fr.NetworkIPAddr = prefix.Masked().Addr()
+
+	if start != "" {
+		addr, err := netip.ParseAddr(start)
+		if err != nil {
+			return fr, fmt.Errorf("invalid pool start %q: %w", start, err)
+		}
+		fr.StartIPAddr = addr
+	}
+
+	if end != "" {
+		addr, err := netip.ParseAddr(end)
+		if err != nil {
+			return fr, fmt.Errorf("invalid pool end %q: %w", end, err)
+		}
+		fr.EndIPAddr = addr
+	}
+
+	if serverIP != "" {
+		addr, err := netip.ParseAddr(serverIP)
+		if err != nil {
+			return fr, fmt.Errorf("invalid server ip %q: %w", serverIP, err)
+		}
+		fr.ServerIPAddr = addr
+	}
+
+	if router != "" {
+		addr, err := netip.ParseAddr(router)
+		if err != nil {
+			return fr, fmt.Errorf("invalid router ip %q: %w", router, err)
+		}
+		fr.RouterIPAddr = addr
+	}
+
+	for _, er := range excludeRanges {
+		start, err := netip.ParseAddr(er.Start)
+		if err != nil {
+			return fr, fmt.Errorf("invalid exclude range start %q: %w", er.Start, err)
+		}
+		end, err := netip.ParseAddr(er.End)
+		if err != nil {
+			return fr, fmt.Errorf("invalid exclude range end %q: %w", er.End, err)
+		}
+		fr.ExcludeRanges = append(fr.ExcludeRanges, ExcludeRange{StartIPAddr: start, EndIPAddr: end})
+	}
+
+	for _, r := range reservations {
+		addr, err := netip.ParseAddr(r.IP)
+		if err != nil {
+			return fr, fmt.Errorf("invalid reservation ip %q: %w", r.IP, err)
+		}
+		mac, err := net.ParseMAC(r.MACAddress)
+		if err != nil {
+			return fr, fmt.Errorf("invalid reservation mac %q: %w", r.MACAddress, err)
+		}
+		fr.Reservations = append(fr.Reservations, Reservation{IPAddr: addr, MACAddress: mac, Hostname: r.Hostname})
+	}
+
+	return fr, nil
+}
+
+// LoadPool parses ipPool's IPv4Config, and IPv6Config if the pool is
+// dual-stack, into a PoolInfo. It only validates that addresses are
+// well-formed; range/overlap/reservation semantics are checked by the
+// webhook validator.
+func LoadPool(ipPool *networkv1.IPPool) (PoolInfo, error) {
+	var pi PoolInfo
+
+	cfg := ipPool.Spec.IPv4Config
+
+	v4, err := loadFamily(cfg.CIDR, cfg.Pool.Start, cfg.Pool.End, cfg.ServerIP, cfg.Router, cfg.ExcludeRanges, cfg.Reservations)
+	if err != nil {
+		return pi, err
+	}
+	pi.IPNet = v4.IPNet
+	pi.Prefix = v4.Prefix
+	pi.NetworkIPAddr = v4.NetworkIPAddr
+	pi.StartIPAddr = v4.StartIPAddr
+	pi.EndIPAddr = v4.EndIPAddr
+	pi.ServerIPAddr = v4.ServerIPAddr
+	pi.RouterIPAddr = v4.RouterIPAddr
+	pi.ExcludeRanges = v4.ExcludeRanges
+	pi.Reservations = v4.Reservations
+
+	if bcast, ok := broadcastAddr(v4.IPNet); ok {
+		pi.BroadcastIPAddr = bcast
+	}
+
+	if v6cfg := ipPool.Spec.IPv6Config; v6cfg != nil {
+		v6, err := loadFamily(v6cfg.CIDR, v6cfg.Pool.Start, v6cfg.Pool.End, v6cfg.ServerIP, v6cfg.Router, v6cfg.ExcludeRanges, v6cfg.Reservations)
+		if err != nil {
+			return pi, err
+		}
+		pi.IPv6IPNet = v6.IPNet
+		pi.IPv6Prefix = v6.Prefix
+		pi.IPv6NetworkIPAddr = v6.NetworkIPAddr
+		pi.IPv6StartIPAddr = v6.StartIPAddr
+		pi.IPv6EndIPAddr = v6.EndIPAddr
+		pi.IPv6ServerIPAddr = v6.ServerIPAddr
+		pi.IPv6RouterIPAddr = v6.RouterIPAddr
+		pi.IPv6ExcludeRanges = v6.ExcludeRanges
+		pi.IPv6Reservations = v6.Reservations
+	}
+
+	if cfg.MACFilter != nil {
+		pi.MACFilter = &MACFilter{
+			Mode:     cfg.MACFilter.Mode,
+			Patterns: cfg.MACFilter.Patterns,
+		}
+	}
+
+	if cfg.DHCPOptions != nil {
+		opts := &DHCPOptions{
+			DomainName:   cfg.DHCPOptions.DomainName,
+			DomainSearch: cfg.DHCPOptions.DomainSearch,
+			MTU:          cfg.DHCPOptions.MTU,
+			BootFileName: cfg.DHCPOptions.BootFileName,
+		}
+
+		for _, s := range cfg.DHCPOptions.DNSServers {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return pi, fmt.Errorf("invalid dns server %q: %w", s, err)
+			}
+			opts.DNSServers = append(opts.DNSServers, addr)
+		}
+
+		for _, s := range cfg.DHCPOptions.NTPServers {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return pi, fmt.Errorf("invalid ntp server %q: %w", s, err)
+			}
+			opts.NTPServers = append(opts.NTPServers, addr)
+		}
+
+		if cfg.DHCPOptions.NextServer != "" {
+			addr, err := netip.ParseAddr(cfg.DHCPOptions.NextServer)
+			if err != nil {
+				return pi, fmt.Errorf("invalid next-server %q: %w", cfg.DHCPOptions.NextServer, err)
+			}
+			opts.NextServer = addr
+		}
+
+		if len(cfg.DHCPOptions.Extra) > 0 {
+			opts.Extra = make(map[int]string, len(cfg.DHCPOptions.Extra))
+			for code, val := range cfg.DHCPOptions.Extra {
+				opts.Extra[code] = val
+			}
+		}
+
+		pi.DHCPOptions = opts
+	}
+
+	return pi, nil
+}
+
+// broadcastAddr returns the all-ones host address of ipNet. IPv6 networks
+// have no broadcast concept, so the second return value is false for them.
+func broadcastAddr(ipNet *net.IPNet) (netip.Addr, bool) {
+	ip4 := ipNet.IP.To4()
+	if ip4 == nil {
+		return netip.Addr{}, false
+	}
+
+	bcast := make(net.IP, len(ip4))
+	for i := range ip4 {
+		bcast[i] = ip4[i] | ^ipNet.Mask[i]
+	}
+
+	addr, ok := netip.AddrFromSlice(bcast)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	return addr, true
+}
+
+// LoadAllocated parses an IPv4Status or IPv6Status Allocated map's keys into netip.Addrs,
+// skipping any that fail to parse rather than failing the whole validation.
+func LoadAllocated(allocated map[string]string) []netip.Addr {
+	addrs := make([]netip.Addr, 0, len(allocated))
+	for ipStr := range allocated {
+		addr, err := netip.ParseAddr(ipStr)
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
@@ -2,13 +2,16 @@ package ippool
 
 import (
 	"fmt"
+	"net"
 	"net/netip"
 	"strings"
+	"sync"
 
 	"github.com/harvester/webhook/pkg/server/admission"
 	"github.com/rancher/wrangler/pkg/kv"
 	"github.com/sirupsen/logrus"
 	admissionregv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	networkv1 "github.com/harvester/vm-dhcp-controller/pkg/apis/network.harvesterhci.io/v1alpha1"
@@ -23,19 +26,60 @@ type Validator struct {
 
 	nadCache      ctlcniv1.NetworkAttachmentDefinitionCache
 	vmnetcfgCache ctlnetworkv1.VirtualMachineNetworkConfigCache
+	ippoolClient  ctlnetworkv1.IPPoolClient
+
+	networkLocks keyedMutex
 }
 
-func NewValidator(nadCache ctlcniv1.NetworkAttachmentDefinitionCache, vmnetcfgCache ctlnetworkv1.VirtualMachineNetworkConfigCache) *Validator {
+func NewValidator(nadCache ctlcniv1.NetworkAttachmentDefinitionCache, vmnetcfgCache ctlnetworkv1.VirtualMachineNetworkConfigCache, ippoolClient ctlnetworkv1.IPPoolClient) *Validator {
 	return &Validator{
 		nadCache:      nadCache,
 		vmnetcfgCache: vmnetcfgCache,
+		ippoolClient:  ippoolClient,
+	}
+}
+
+// keyedMutex serializes admission reviews per key (here, per network) within
+// this webhook process: two concurrent Create/Update requests for pools on
+// the same network take turns rather than both running checkOverlap at once.
+//
+// This is a mitigation, not a guarantee. It only orders requests handled by
+// this process; it does nothing for requests landing on a different replica
+// of the webhook, and a read against the API server can still race a write
+// that hasn't been accepted yet. Closing that gap needs a server-side
+// mechanism (e.g. optimistic concurrency on the IPPool's resourceVersion, or
+// a distributed lease) plus a controller-side reconciler that catches and
+// reports any overlap that slips through. Pair this lock with a live (non-
+// cached) read in checkOverlap to at least remove informer-resync lag from
+// the window.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*sync.Mutex)
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		k.locks[key] = l
 	}
+	k.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
 }
 
 func (v *Validator) Create(_ *admission.Request, newObj runtime.Object) error {
 	ipPool := newObj.(*networkv1.IPPool)
 	logrus.Infof("create ippool %s/%s", ipPool.Namespace, ipPool.Name)
 
+	unlock := v.networkLocks.Lock(ipPool.Spec.NetworkName)
+	defer unlock()
+
 	// sanity check
 	poolInfo, err := util.LoadPool(ipPool)
 	if err != nil {
@@ -46,15 +90,25 @@ func (v *Validator) Create(_ *admission.Request, newObj runtime.Object) error {
 		return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
 	}
 
-	if err := v.checkPoolRange(poolInfo); err != nil {
+	if err := v.checkFamily(v4View(poolInfo)); err != nil {
 		return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
 	}
 
-	if err := v.checkServerIP(poolInfo); err != nil {
+	if v6, ok := v6View(poolInfo); ok {
+		if err := v.checkFamily(v6); err != nil {
+			return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
+		}
+	}
+
+	if err := v.checkOverlap(ipPool, poolInfo); err != nil {
+		return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
+	}
+
+	if err := v.checkMACFilter(poolInfo); err != nil {
 		return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
 	}
 
-	if err := v.checkRouter(poolInfo); err != nil {
+	if err := v.checkDHCPOptions(poolInfo); err != nil {
 		return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
 	}
 
@@ -70,6 +124,9 @@ func (v *Validator) Update(_ *admission.Request, _, newObj runtime.Object) error
 
 	logrus.Infof("update ippool %s/%s", ipPool.Namespace, ipPool.Name)
 
+	unlock := v.networkLocks.Lock(ipPool.Spec.NetworkName)
+	defer unlock()
+
 	// sanity check
 	poolInfo, err := util.LoadPool(ipPool)
 	if err != nil {
@@ -81,19 +138,34 @@ func (v *Validator) Update(_ *admission.Request, _, newObj runtime.Object) error
 		allocatedIPAddrList = util.LoadAllocated(ipPool.Status.IPv4.Allocated)
 	}
 
+	var allocatedIPv6AddrList []netip.Addr
+	if ipPool.Status.IPv6 != nil {
+		allocatedIPv6AddrList = util.LoadAllocated(ipPool.Status.IPv6.Allocated)
+	}
+
 	if err := v.checkNAD(ipPool.Spec.NetworkName); err != nil {
 		return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
 	}
 
-	if err := v.checkPoolRange(poolInfo); err != nil {
+	if err := v.checkFamily(v4View(poolInfo), allocatedIPAddrList...); err != nil {
 		return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
 	}
 
-	if err := v.checkServerIP(poolInfo, allocatedIPAddrList...); err != nil {
+	if v6, ok := v6View(poolInfo); ok {
+		if err := v.checkFamily(v6, allocatedIPv6AddrList...); err != nil {
+			return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
+		}
+	}
+
+	if err := v.checkOverlap(ipPool, poolInfo); err != nil {
+		return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
+	}
+
+	if err := v.checkMACFilter(poolInfo); err != nil {
 		return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
 	}
 
-	if err := v.checkRouter(poolInfo); err != nil {
+	if err := v.checkDHCPOptions(poolInfo); err != nil {
 		return fmt.Errorf(webhook.CreateErr, "IPPool", ipPool.Namespace, ipPool.Name, err)
 	}
 
@@ -136,82 +208,371 @@ func (v *Validator) checkNAD(namespacedName string) error {
 	return err
 }
 
-func (v *Validator) checkPoolRange(pi util.PoolInfo) error {
-	if pi.StartIPAddr.IsValid() {
-		if !pi.IPNet.Contains(pi.StartIPAddr.AsSlice()) {
-			return fmt.Errorf("start ip %s is not within subnet", pi.StartIPAddr)
+// familyView is the per-address-family slice of a PoolInfo that the range,
+// server/router, exclude-range and reservation checks operate on. Deriving
+// it from either the IPv4 or the IPv6 fields lets those checks run unchanged
+// against both stacks of a dual-stack pool.
+type familyView struct {
+	IPNet           *net.IPNet
+	Prefix          netip.Prefix
+	NetworkIPAddr   netip.Addr
+	BroadcastIPAddr netip.Addr
+
+	StartIPAddr netip.Addr
+	EndIPAddr   netip.Addr
+
+	ServerIPAddr netip.Addr
+	RouterIPAddr netip.Addr
+
+	ExcludeRanges []util.ExcludeRange
+	Reservations  []util.Reservation
+}
+
+func v4View(pi util.PoolInfo) familyView {
+	return familyView{
+		IPNet:           pi.IPNet,
+		Prefix:          pi.Prefix,
+		NetworkIPAddr:   pi.NetworkIPAddr,
+		BroadcastIPAddr: pi.BroadcastIPAddr,
+		StartIPAddr:     pi.StartIPAddr,
+		EndIPAddr:       pi.EndIPAddr,
+		ServerIPAddr:    pi.ServerIPAddr,
+		RouterIPAddr:    pi.RouterIPAddr,
+		ExcludeRanges:   pi.ExcludeRanges,
+		Reservations:    pi.Reservations,
+	}
+}
+
+// v6View returns pi's IPv6 familyView and true, or a zero value and false if
+// pi isn't dual-stack (no IPv6Config).
+func v6View(pi util.PoolInfo) (familyView, bool) {
+	if pi.IPv6IPNet == nil {
+		return familyView{}, false
+	}
+	return familyView{
+		IPNet:         pi.IPv6IPNet,
+		Prefix:        pi.IPv6Prefix,
+		NetworkIPAddr: pi.IPv6NetworkIPAddr,
+		StartIPAddr:   pi.IPv6StartIPAddr,
+		EndIPAddr:     pi.IPv6EndIPAddr,
+		ServerIPAddr:  pi.IPv6ServerIPAddr,
+		RouterIPAddr:  pi.IPv6RouterIPAddr,
+		ExcludeRanges: pi.IPv6ExcludeRanges,
+		Reservations:  pi.IPv6Reservations,
+	}, true
+}
+
+func (v *Validator) checkPoolRange(fv familyView) error {
+	if fv.StartIPAddr.IsValid() {
+		if !fv.IPNet.Contains(fv.StartIPAddr.AsSlice()) {
+			return fmt.Errorf("start ip %s is not within subnet", fv.StartIPAddr)
 		}
 
-		if pi.StartIPAddr.As4() == pi.NetworkIPAddr.As4() {
-			return fmt.Errorf("start ip %s is the same as network ip", pi.StartIPAddr)
+		if fv.StartIPAddr == fv.NetworkIPAddr {
+			return fmt.Errorf("start ip %s is the same as network ip", fv.StartIPAddr)
 		}
 
-		if pi.StartIPAddr.As4() == pi.BroadcastIPAddr.As4() {
-			return fmt.Errorf("start ip %s is the same as broadcast ip", pi.StartIPAddr)
+		// the all-zeroes/all-ones broadcast concept is IPv4-only; IPv6 subnets have no broadcast address
+		if fv.BroadcastIPAddr.IsValid() && fv.StartIPAddr == fv.BroadcastIPAddr {
+			return fmt.Errorf("start ip %s is the same as broadcast ip", fv.StartIPAddr)
 		}
 	}
 
-	if pi.EndIPAddr.IsValid() {
-		if !pi.IPNet.Contains(pi.EndIPAddr.AsSlice()) {
-			return fmt.Errorf("end ip %s is not within subnet", pi.EndIPAddr)
+	if fv.EndIPAddr.IsValid() {
+		if !fv.IPNet.Contains(fv.EndIPAddr.AsSlice()) {
+			return fmt.Errorf("end ip %s is not within subnet", fv.EndIPAddr)
 		}
 
-		if pi.EndIPAddr.As4() == pi.NetworkIPAddr.As4() {
-			return fmt.Errorf("end ip %s is the same as network ip", pi.EndIPAddr)
+		if fv.EndIPAddr == fv.NetworkIPAddr {
+			return fmt.Errorf("end ip %s is the same as network ip", fv.EndIPAddr)
 		}
 
-		if pi.EndIPAddr.As4() == pi.BroadcastIPAddr.As4() {
-			return fmt.Errorf("end ip %s is the same as broadcast ip", pi.EndIPAddr)
+		if fv.BroadcastIPAddr.IsValid() && fv.EndIPAddr == fv.BroadcastIPAddr {
+			return fmt.Errorf("end ip %s is the same as broadcast ip", fv.EndIPAddr)
 		}
 	}
 	return nil
 }
 
-func (v *Validator) checkServerIP(pi util.PoolInfo, allocatedIPs ...netip.Addr) error {
-	if !pi.ServerIPAddr.IsValid() {
+func (v *Validator) checkServerIP(fv familyView, allocatedIPs ...netip.Addr) error {
+	if !fv.ServerIPAddr.IsValid() {
 		return nil
 	}
 
-	if !pi.IPNet.Contains(pi.ServerIPAddr.AsSlice()) {
-		return fmt.Errorf("server ip %s is not within subnet", pi.ServerIPAddr)
+	if !fv.IPNet.Contains(fv.ServerIPAddr.AsSlice()) {
+		return fmt.Errorf("server ip %s is not within subnet", fv.ServerIPAddr)
 	}
 
-	if pi.ServerIPAddr.As4() == pi.NetworkIPAddr.As4() {
-		return fmt.Errorf("server ip %s cannot be the same as network ip", pi.ServerIPAddr)
+	if fv.ServerIPAddr == fv.NetworkIPAddr {
+		return fmt.Errorf("server ip %s cannot be the same as network ip", fv.ServerIPAddr)
 	}
 
-	if pi.ServerIPAddr.As4() == pi.BroadcastIPAddr.As4() {
-		return fmt.Errorf("server ip %s cannot be the same as broadcast ip", pi.ServerIPAddr)
+	if fv.BroadcastIPAddr.IsValid() && fv.ServerIPAddr == fv.BroadcastIPAddr {
+		return fmt.Errorf("server ip %s cannot be the same as broadcast ip", fv.ServerIPAddr)
 	}
 
-	if pi.RouterIPAddr.IsValid() && pi.ServerIPAddr.As4() == pi.RouterIPAddr.As4() {
-		return fmt.Errorf("server ip %s cannot be the same as router ip", pi.ServerIPAddr)
+	if fv.RouterIPAddr.IsValid() && fv.ServerIPAddr == fv.RouterIPAddr {
+		return fmt.Errorf("server ip %s cannot be the same as router ip", fv.ServerIPAddr)
 	}
 
 	for _, ip := range allocatedIPs {
-		if pi.ServerIPAddr == ip {
-			return fmt.Errorf("server ip %s is already allocated", pi.ServerIPAddr)
+		if fv.ServerIPAddr == ip {
+			return fmt.Errorf("server ip %s is already allocated", fv.ServerIPAddr)
 		}
 	}
 
 	return nil
 }
 
-func (v *Validator) checkRouter(pi util.PoolInfo) error {
-	if !pi.RouterIPAddr.IsValid() {
+func (v *Validator) checkRouter(fv familyView) error {
+	if !fv.RouterIPAddr.IsValid() {
+		return nil
+	}
+
+	if !fv.IPNet.Contains(fv.RouterIPAddr.AsSlice()) {
+		return fmt.Errorf("router ip %s is not within subnet", fv.RouterIPAddr)
+	}
+
+	if fv.RouterIPAddr == fv.NetworkIPAddr {
+		return fmt.Errorf("router ip %s is the same as network ip", fv.RouterIPAddr)
+	}
+
+	if fv.BroadcastIPAddr.IsValid() && fv.RouterIPAddr == fv.BroadcastIPAddr {
+		return fmt.Errorf("router ip %s is the same as broadcast ip", fv.RouterIPAddr)
+	}
+
+	return nil
+}
+
+// checkFamily runs the range/server/router/exclude-range/reservation checks
+// against a single address family's view of the pool. Create/Update call it
+// once for the required IPv4 family and, for dual-stack pools, once more for
+// IPv6.
+func (v *Validator) checkFamily(fv familyView, allocatedIPs ...netip.Addr) error {
+	if err := v.checkPoolRange(fv); err != nil {
+		return err
+	}
+
+	if err := v.checkServerIP(fv, allocatedIPs...); err != nil {
+		return err
+	}
+
+	if err := v.checkRouter(fv); err != nil {
+		return err
+	}
+
+	if err := v.checkExcludeRanges(fv); err != nil {
+		return err
+	}
+
+	if err := v.checkReservations(fv); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// knownDHCPOptionCodes are the extra (untyped) DHCP option codes the agent
+// knows how to render into dnsmasq/dhcpd args via DHCPOptions.Extra. Codes
+// already modeled as dedicated DHCPOptions fields (6 DNS, 15 domain name,
+// 26 MTU, 42 NTP, 119 domain search) are deliberately excluded here: they
+// must go through their typed field, not Extra, so there's one way to set
+// them.
+var knownDHCPOptionCodes = map[int]struct{}{
+	19:  {}, // ip forwarding
+	43:  {}, // vendor specific information
+	121: {}, // classless static routes
+	150: {}, // tftp server address
+	252: {}, // wpad
+}
+
+func (v *Validator) checkMACFilter(pi util.PoolInfo) error {
+	if pi.MACFilter == nil {
 		return nil
 	}
 
-	if !pi.IPNet.Contains(pi.RouterIPAddr.AsSlice()) {
-		return fmt.Errorf("router ip %s is not within subnet", pi.RouterIPAddr)
+	switch pi.MACFilter.Mode {
+	case networkv1.MACFilterModeAllow, networkv1.MACFilterModeDeny:
+	default:
+		return fmt.Errorf("mac filter mode %q must be either %q or %q", pi.MACFilter.Mode, networkv1.MACFilterModeAllow, networkv1.MACFilterModeDeny)
+	}
+
+	for _, pattern := range pi.MACFilter.Patterns {
+		// an OUI prefix (e.g. "52:54:00") is allowed alongside a full address
+		if _, err := net.ParseMAC(pattern); err != nil {
+			if _, err := net.ParseMAC(pattern + ":00:00:00"); err != nil {
+				return fmt.Errorf("mac filter pattern %q is not a valid mac address or oui prefix", pattern)
+			}
+		}
 	}
 
-	if pi.RouterIPAddr.As4() == pi.NetworkIPAddr.As4() {
-		return fmt.Errorf("router ip %s is the same as network ip", pi.RouterIPAddr)
+	return nil
+}
+
+func (v *Validator) checkDHCPOptions(pi util.PoolInfo) error {
+	if pi.DHCPOptions == nil {
+		return nil
 	}
 
-	if pi.RouterIPAddr.As4() == pi.BroadcastIPAddr.As4() {
-		return fmt.Errorf("router ip %s is the same as broadcast ip", pi.BroadcastIPAddr)
+	for _, addr := range pi.DHCPOptions.DNSServers {
+		if !pi.IPNet.Contains(addr.AsSlice()) && !addr.IsGlobalUnicast() {
+			return fmt.Errorf("dns server %s is not a routable address", addr)
+		}
+	}
+
+	for _, addr := range pi.DHCPOptions.NTPServers {
+		if !pi.IPNet.Contains(addr.AsSlice()) && !addr.IsGlobalUnicast() {
+			return fmt.Errorf("ntp server %s is not a routable address", addr)
+		}
+	}
+
+	if pi.DHCPOptions.NextServer.IsValid() && !pi.DHCPOptions.NextServer.IsGlobalUnicast() {
+		return fmt.Errorf("next-server %s is not a routable address", pi.DHCPOptions.NextServer)
+	}
+
+	if pi.DHCPOptions.BootFileName != "" && !pi.DHCPOptions.NextServer.IsValid() {
+		return fmt.Errorf("bootfile-name requires next-server to be set")
+	}
+
+	for code := range pi.DHCPOptions.Extra {
+		if _, ok := knownDHCPOptionCodes[code]; !ok {
+			return fmt.Errorf("dhcp option code %d is not supported", code)
+		}
+	}
+
+	return nil
+}
+
+func (v *Validator) checkOverlap(ipPool *networkv1.IPPool, pi util.PoolInfo) error {
+	// List live against the API server rather than through the informer
+	// cache: admission runs synchronously with the write, so a cache read
+	// here could still miss a sibling that was just created or updated.
+	// See the keyedMutex doc comment for what this does and doesn't close.
+	list, err := v.ippoolClient.List(metav1.NamespaceAll, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for i := range list.Items {
+		sibling := &list.Items[i]
+		if sibling.Namespace == ipPool.Namespace && sibling.Name == ipPool.Name {
+			continue
+		}
+
+		if sibling.Spec.NetworkName != ipPool.Spec.NetworkName {
+			continue
+		}
+
+		siblingPoolInfo, err := util.LoadPool(sibling)
+		if err != nil {
+			return err
+		}
+
+		if reason, conflicts := poolConflict(v4View(pi), v4View(siblingPoolInfo)); conflicts {
+			return fmt.Errorf("%s overlaps with ippool %s/%s on network %s", reason, sibling.Namespace, sibling.Name, ipPool.Spec.NetworkName)
+		}
+
+		v6, ok := v6View(pi)
+		siblingV6, siblingOk := v6View(siblingPoolInfo)
+		if ok && siblingOk {
+			if reason, conflicts := poolConflict(v6, siblingV6); conflicts {
+				return fmt.Errorf("%s overlaps with ippool %s/%s on network %s", reason, sibling.Namespace, sibling.Name, ipPool.Spec.NetworkName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// poolConflict reports whether a and b, two same-family views bound to the
+// same network, would double-allocate addresses. It is pure so it can be
+// exercised without an IPPool cache.
+func poolConflict(a, b familyView) (string, bool) {
+	if a.Prefix.Overlaps(b.Prefix) {
+		return fmt.Sprintf("cidr %s", a.Prefix), true
+	}
+
+	if rangesIntersect(a, b) {
+		return fmt.Sprintf("range %s-%s", a.StartIPAddr, a.EndIPAddr), true
+	}
+
+	if a.ServerIPAddr.IsValid() && a.ServerIPAddr == b.ServerIPAddr {
+		return fmt.Sprintf("server ip %s", a.ServerIPAddr), true
+	}
+
+	if a.RouterIPAddr.IsValid() && a.RouterIPAddr == b.RouterIPAddr {
+		return fmt.Sprintf("router ip %s", a.RouterIPAddr), true
+	}
+
+	return "", false
+}
+
+func rangesIntersect(a, b familyView) bool {
+	if !a.StartIPAddr.IsValid() || !a.EndIPAddr.IsValid() || !b.StartIPAddr.IsValid() || !b.EndIPAddr.IsValid() {
+		return false
+	}
+	return !a.EndIPAddr.Less(b.StartIPAddr) && !b.EndIPAddr.Less(a.StartIPAddr)
+}
+
+func (v *Validator) checkExcludeRanges(fv familyView) error {
+	for _, er := range fv.ExcludeRanges {
+		if !er.StartIPAddr.IsValid() || !er.EndIPAddr.IsValid() {
+			return fmt.Errorf("exclude range %s-%s is invalid", er.StartIPAddr, er.EndIPAddr)
+		}
+
+		if er.EndIPAddr.Less(er.StartIPAddr) {
+			return fmt.Errorf("exclude range %s-%s is reversed", er.StartIPAddr, er.EndIPAddr)
+		}
+
+		if !fv.IPNet.Contains(er.StartIPAddr.AsSlice()) || !fv.IPNet.Contains(er.EndIPAddr.AsSlice()) {
+			return fmt.Errorf("exclude range %s-%s is not within subnet", er.StartIPAddr, er.EndIPAddr)
+		}
+
+		if fv.ServerIPAddr.IsValid() && er.Contains(fv.ServerIPAddr) {
+			return fmt.Errorf("exclude range %s-%s covers the server ip %s", er.StartIPAddr, er.EndIPAddr, fv.ServerIPAddr)
+		}
+
+		if fv.RouterIPAddr.IsValid() && er.Contains(fv.RouterIPAddr) {
+			return fmt.Errorf("exclude range %s-%s covers the router ip %s", er.StartIPAddr, er.EndIPAddr, fv.RouterIPAddr)
+		}
+	}
+
+	return nil
+}
+
+func (v *Validator) checkReservations(fv familyView) error {
+	seenIPs := make(map[netip.Addr]string, len(fv.Reservations))
+	seenMACs := make(map[string]netip.Addr, len(fv.Reservations))
+
+	for _, r := range fv.Reservations {
+		if !r.IPAddr.IsValid() {
+			return fmt.Errorf("reservation %s has an invalid ip", r.MACAddress)
+		}
+
+		if !fv.IPNet.Contains(r.IPAddr.AsSlice()) {
+			return fmt.Errorf("reservation ip %s is not within subnet", r.IPAddr)
+		}
+
+		if fv.StartIPAddr.IsValid() && fv.EndIPAddr.IsValid() &&
+			(r.IPAddr.Less(fv.StartIPAddr) || fv.EndIPAddr.Less(r.IPAddr)) {
+			return fmt.Errorf("reservation ip %s is outside the pool range %s-%s", r.IPAddr, fv.StartIPAddr, fv.EndIPAddr)
+		}
+
+		for _, er := range fv.ExcludeRanges {
+			if er.Contains(r.IPAddr) {
+				return fmt.Errorf("reservation ip %s falls inside exclude range %s-%s", r.IPAddr, er.StartIPAddr, er.EndIPAddr)
+			}
+		}
+
+		if hostname, ok := seenIPs[r.IPAddr]; ok {
+			return fmt.Errorf("reservation ip %s is claimed by both %s and %s", r.IPAddr, hostname, r.Hostname)
+		}
+		seenIPs[r.IPAddr] = r.Hostname
+
+		if ipAddr, ok := seenMACs[r.MACAddress.String()]; ok {
+			return fmt.Errorf("mac address %s is reserved for both %s and %s", r.MACAddress, ipAddr, r.IPAddr)
+		}
+		seenMACs[r.MACAddress.String()] = r.IPAddr
 	}
 
 	return nil
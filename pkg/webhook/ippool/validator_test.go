@@ -0,0 +1,435 @@
+package ippool
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/harvester/vm-dhcp-controller/pkg/util"
+)
+
+func testPoolInfo(t *testing.T) util.PoolInfo {
+	t.Helper()
+
+	_, ipNet, err := net.ParseCIDR("192.168.0.0/24")
+	require.NoError(t, err)
+
+	return util.PoolInfo{
+		IPNet:           ipNet,
+		Prefix:          netip.MustParsePrefix("192.168.0.0/24"),
+		NetworkIPAddr:   netip.MustParseAddr("192.168.0.0"),
+		BroadcastIPAddr: netip.MustParseAddr("192.168.0.255"),
+		StartIPAddr:     netip.MustParseAddr("192.168.0.10"),
+		EndIPAddr:       netip.MustParseAddr("192.168.0.200"),
+		ServerIPAddr:    netip.MustParseAddr("192.168.0.2"),
+		RouterIPAddr:    netip.MustParseAddr("192.168.0.1"),
+	}
+}
+
+func testExcludeRange(t *testing.T, start, end string) util.ExcludeRange {
+	t.Helper()
+	return util.ExcludeRange{
+		StartIPAddr: netip.MustParseAddr(start),
+		EndIPAddr:   netip.MustParseAddr(end),
+	}
+}
+
+func testReservation(t *testing.T, ip, mac, hostname string) util.Reservation {
+	t.Helper()
+	hw, err := net.ParseMAC(mac)
+	require.NoError(t, err)
+	return util.Reservation{
+		IPAddr:     netip.MustParseAddr(ip),
+		MACAddress: hw,
+		Hostname:   hostname,
+	}
+}
+
+func TestValidator_checkExcludeRanges(t *testing.T) {
+	v := &Validator{}
+
+	cases := []struct {
+		name    string
+		ranges  []util.ExcludeRange
+		wantErr string
+	}{
+		{
+			name: "valid range inside pool",
+			ranges: []util.ExcludeRange{
+				testExcludeRange(t, "192.168.0.20", "192.168.0.30"),
+			},
+		},
+		{
+			name: "reversed range",
+			ranges: []util.ExcludeRange{
+				testExcludeRange(t, "192.168.0.30", "192.168.0.20"),
+			},
+			wantErr: "reversed",
+		},
+		{
+			name: "range outside subnet",
+			ranges: []util.ExcludeRange{
+				testExcludeRange(t, "192.168.1.20", "192.168.1.30"),
+			},
+			wantErr: "not within subnet",
+		},
+		{
+			name: "range covers server ip",
+			ranges: []util.ExcludeRange{
+				testExcludeRange(t, "192.168.0.1", "192.168.0.5"),
+			},
+			wantErr: "covers the server ip",
+		},
+		{
+			name: "range covers router ip",
+			ranges: []util.ExcludeRange{
+				testExcludeRange(t, "192.168.0.1", "192.168.0.1"),
+			},
+			wantErr: "covers the router ip",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pi := testPoolInfo(t)
+			pi.ExcludeRanges = tc.ranges
+
+			err := v.checkExcludeRanges(v4View(pi))
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestKeyedMutex(t *testing.T) {
+	var km keyedMutex
+
+	t.Run("same key serializes", func(t *testing.T) {
+		var inCriticalSection int32
+		var sawOverlap int32
+		var wg sync.WaitGroup
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				unlock := km.Lock("net-a")
+				defer unlock()
+
+				if atomic.AddInt32(&inCriticalSection, 1) > 1 {
+					atomic.StoreInt32(&sawOverlap, 1)
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&inCriticalSection, -1)
+			}()
+		}
+		wg.Wait()
+
+		require.Zero(t, sawOverlap, "two goroutines held the same key's lock at once")
+	})
+
+	t.Run("different keys do not block each other", func(t *testing.T) {
+		unlockA := km.Lock("net-a")
+		defer unlockA()
+
+		done := make(chan struct{})
+		go func() {
+			unlockB := km.Lock("net-b")
+			defer unlockB()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("lock on a different key blocked unexpectedly")
+		}
+	})
+}
+
+func TestPoolConflict(t *testing.T) {
+	base := testPoolInfo(t)
+
+	cases := []struct {
+		name         string
+		other        func(util.PoolInfo) util.PoolInfo
+		wantConflict bool
+	}{
+		{
+			name: "identical cidr conflicts",
+			other: func(pi util.PoolInfo) util.PoolInfo {
+				return pi
+			},
+			wantConflict: true,
+		},
+		{
+			name: "disjoint cidr and range does not conflict",
+			other: func(pi util.PoolInfo) util.PoolInfo {
+				pi.Prefix = netip.MustParsePrefix("10.0.0.0/24")
+				pi.StartIPAddr = netip.MustParseAddr("10.0.0.10")
+				pi.EndIPAddr = netip.MustParseAddr("10.0.0.200")
+				pi.ServerIPAddr = netip.MustParseAddr("10.0.0.2")
+				pi.RouterIPAddr = netip.MustParseAddr("10.0.0.1")
+				return pi
+			},
+			wantConflict: false,
+		},
+		{
+			name: "same server ip on a different cidr conflicts",
+			other: func(pi util.PoolInfo) util.PoolInfo {
+				pi.Prefix = netip.MustParsePrefix("10.0.0.0/24")
+				pi.StartIPAddr = netip.MustParseAddr("10.0.0.10")
+				pi.EndIPAddr = netip.MustParseAddr("10.0.0.200")
+				pi.RouterIPAddr = netip.MustParseAddr("10.0.0.1")
+				return pi // ServerIPAddr left equal to base's
+			},
+			wantConflict: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			other := tc.other(base)
+			_, conflicts := poolConflict(v4View(base), v4View(other))
+			require.Equal(t, tc.wantConflict, conflicts)
+		})
+	}
+}
+
+func TestRangesIntersect(t *testing.T) {
+	a := testPoolInfo(t)
+
+	b := a
+	b.StartIPAddr = netip.MustParseAddr("192.168.0.150")
+	b.EndIPAddr = netip.MustParseAddr("192.168.0.250")
+	require.True(t, rangesIntersect(v4View(a), v4View(b)))
+
+	c := a
+	c.StartIPAddr = netip.MustParseAddr("192.168.0.201")
+	c.EndIPAddr = netip.MustParseAddr("192.168.0.210")
+	require.False(t, rangesIntersect(v4View(a), v4View(c)))
+}
+
+func TestValidator_checkMACFilter(t *testing.T) {
+	v := &Validator{}
+
+	cases := []struct {
+		name    string
+		filter  *util.MACFilter
+		wantErr string
+	}{
+		{
+			name:   "nil filter is fine",
+			filter: nil,
+		},
+		{
+			name:   "allow mode with full addresses",
+			filter: &util.MACFilter{Mode: "allow", Patterns: []string{"52:54:00:00:00:01"}},
+		},
+		{
+			name:   "deny mode with an oui prefix",
+			filter: &util.MACFilter{Mode: "deny", Patterns: []string{"52:54:00"}},
+		},
+		{
+			name:    "invalid mode",
+			filter:  &util.MACFilter{Mode: "block", Patterns: []string{"52:54:00:00:00:01"}},
+			wantErr: "must be either",
+		},
+		{
+			name:    "invalid pattern",
+			filter:  &util.MACFilter{Mode: "allow", Patterns: []string{"not-a-mac"}},
+			wantErr: "not a valid mac address",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pi := testPoolInfo(t)
+			pi.MACFilter = tc.filter
+
+			err := v.checkMACFilter(pi)
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestValidator_checkDHCPOptions(t *testing.T) {
+	v := &Validator{}
+
+	cases := []struct {
+		name    string
+		opts    *util.DHCPOptions
+		wantErr string
+	}{
+		{
+			name: "nil options is fine",
+			opts: nil,
+		},
+		{
+			name: "routable dns and ntp servers",
+			opts: &util.DHCPOptions{
+				DNSServers: []netip.Addr{netip.MustParseAddr("8.8.8.8")},
+				NTPServers: []netip.Addr{netip.MustParseAddr("192.168.0.5")},
+			},
+		},
+		{
+			name: "bootfile name without next-server",
+			opts: &util.DHCPOptions{
+				BootFileName: "pxelinux.0",
+			},
+			wantErr: "requires next-server",
+		},
+		{
+			name: "known extra option code",
+			opts: &util.DHCPOptions{
+				Extra: map[int]string{121: "0.0.0.0/0,192.168.0.1"},
+			},
+		},
+		{
+			name: "unsupported extra option code",
+			opts: &util.DHCPOptions{
+				Extra: map[int]string{9999: "whatever"},
+			},
+			wantErr: "not supported",
+		},
+		{
+			name: "extra cannot duplicate the typed ntp servers option",
+			opts: &util.DHCPOptions{
+				Extra: map[int]string{42: "192.168.0.5"},
+			},
+			wantErr: "not supported",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pi := testPoolInfo(t)
+			pi.DHCPOptions = tc.opts
+
+			err := v.checkDHCPOptions(pi)
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestValidator_checkReservations(t *testing.T) {
+	v := &Validator{}
+
+	cases := []struct {
+		name         string
+		reservations []util.Reservation
+		excludes     []util.ExcludeRange
+		wantErr      string
+	}{
+		{
+			name: "valid reservation",
+			reservations: []util.Reservation{
+				testReservation(t, "192.168.0.50", "52:54:00:00:00:01", "vm-a"),
+			},
+		},
+		{
+			name: "reservation outside pool range",
+			reservations: []util.Reservation{
+				testReservation(t, "192.168.0.5", "52:54:00:00:00:01", "vm-a"),
+			},
+			wantErr: "outside the pool range",
+		},
+		{
+			name: "reservation inside exclude range",
+			excludes: []util.ExcludeRange{
+				testExcludeRange(t, "192.168.0.40", "192.168.0.60"),
+			},
+			reservations: []util.Reservation{
+				testReservation(t, "192.168.0.50", "52:54:00:00:00:01", "vm-a"),
+			},
+			wantErr: "exclude range",
+		},
+		{
+			name: "duplicate ip",
+			reservations: []util.Reservation{
+				testReservation(t, "192.168.0.50", "52:54:00:00:00:01", "vm-a"),
+				testReservation(t, "192.168.0.50", "52:54:00:00:00:02", "vm-b"),
+			},
+			wantErr: "claimed by both",
+		},
+		{
+			name: "duplicate mac",
+			reservations: []util.Reservation{
+				testReservation(t, "192.168.0.50", "52:54:00:00:00:01", "vm-a"),
+				testReservation(t, "192.168.0.51", "52:54:00:00:00:01", "vm-b"),
+			},
+			wantErr: "reserved for both",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pi := testPoolInfo(t)
+			pi.ExcludeRanges = tc.excludes
+			pi.Reservations = tc.reservations
+
+			err := v.checkReservations(v4View(pi))
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestV6View(t *testing.T) {
+	pi := testPoolInfo(t)
+
+	_, ok := v6View(pi)
+	require.False(t, ok, "a v4-only pool has no v6 view")
+
+	_, ipv6Net, err := net.ParseCIDR("fd00::/64")
+	require.NoError(t, err)
+	pi.IPv6IPNet = ipv6Net
+	pi.IPv6Prefix = netip.MustParsePrefix("fd00::/64")
+	pi.IPv6StartIPAddr = netip.MustParseAddr("fd00::10")
+	pi.IPv6EndIPAddr = netip.MustParseAddr("fd00::100")
+
+	fv, ok := v6View(pi)
+	require.True(t, ok)
+	require.Equal(t, pi.IPv6StartIPAddr, fv.StartIPAddr)
+	require.Equal(t, pi.IPv6EndIPAddr, fv.EndIPAddr)
+}
+
+func TestValidator_checkFamily_dualStack(t *testing.T) {
+	v := &Validator{}
+	pi := testPoolInfo(t)
+
+	_, ipv6Net, err := net.ParseCIDR("fd00::/64")
+	require.NoError(t, err)
+	pi.IPv6IPNet = ipv6Net
+	pi.IPv6Prefix = netip.MustParsePrefix("fd00::/64")
+	pi.IPv6NetworkIPAddr = netip.MustParseAddr("fd00::")
+	pi.IPv6StartIPAddr = netip.MustParseAddr("fd00::10")
+	pi.IPv6EndIPAddr = netip.MustParseAddr("fd00::100")
+	pi.IPv6RouterIPAddr = netip.MustParseAddr("fd00::1")
+
+	fv, ok := v6View(pi)
+	require.True(t, ok)
+	require.NoError(t, v.checkFamily(fv))
+
+	fv.StartIPAddr = netip.MustParseAddr("fe00::10")
+	require.ErrorContains(t, v.checkFamily(fv), "not within subnet")
+}